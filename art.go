@@ -0,0 +1,235 @@
+package caskdb
+
+import "sort"
+
+// ARTIndex is an Index backed by an adaptive radix tree: a byte-oriented
+// radix trie where each edge is labelled with the (possibly multi-byte)
+// substring shared by every key below it. Keys with a common prefix share
+// the nodes covering that prefix instead of each storing it in full, which
+// keeps memory low for datasets with many similar keys, and Scan visits
+// keys in sorted order, making prefix scans a single subtree walk instead
+// of a full-index filter.
+type ARTIndex struct {
+	root *radixNode
+	size int
+}
+
+// NewARTIndex returns an empty ARTIndex.
+func NewARTIndex() *ARTIndex {
+	return &ARTIndex{root: newRadixNode(nil)}
+}
+
+func (idx *ARTIndex) Get(key []byte) (keyEntry, bool) {
+	return idx.root.get(key)
+}
+
+func (idx *ARTIndex) Put(key []byte, e keyEntry) {
+	if idx.root.put(key, e) {
+		idx.size++
+	}
+}
+
+func (idx *ARTIndex) Delete(key []byte) {
+	if idx.root.delete(key) {
+		idx.size--
+	}
+}
+
+func (idx *ARTIndex) Len() int {
+	return idx.size
+}
+
+func (idx *ARTIndex) Scan(prefix []byte, fn func(key []byte, e keyEntry) bool) {
+	idx.root.scan(prefix, fn)
+}
+
+// radixNode is one node of the tree. prefix holds the edge bytes leading
+// into this node from its parent, excluding the first byte of that edge
+// (which is instead the key the parent uses to look this node up in its
+// children map) so that the first byte of every entry in a children map is
+// distinct.
+type radixNode struct {
+	prefix   []byte
+	children map[byte]*radixNode
+	hasValue bool
+	value    keyEntry
+}
+
+func newRadixNode(prefix []byte) *radixNode {
+	return &radixNode{prefix: prefix, children: map[byte]*radixNode{}}
+}
+
+func commonPrefixLen(a, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	i := 0
+	for i < n && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+func (n *radixNode) get(key []byte) (keyEntry, bool) {
+	for {
+		if len(key) == 0 {
+			return n.value, n.hasValue
+		}
+		c, ok := n.children[key[0]]
+		if !ok {
+			return keyEntry{}, false
+		}
+		rest := key[1:]
+		if len(rest) < len(c.prefix) || commonPrefixLen(rest, c.prefix) != len(c.prefix) {
+			return keyEntry{}, false
+		}
+		n = c
+		key = rest[len(c.prefix):]
+	}
+}
+
+// put inserts or overwrites key and reports whether key was not already
+// present.
+func (n *radixNode) put(key []byte, e keyEntry) bool {
+	for {
+		if len(key) == 0 {
+			isNew := !n.hasValue
+			n.hasValue = true
+			n.value = e
+			return isNew
+		}
+
+		c, ok := n.children[key[0]]
+		if !ok {
+			n.children[key[0]] = &radixNode{
+				prefix:   append([]byte(nil), key[1:]...),
+				children: map[byte]*radixNode{},
+				hasValue: true,
+				value:    e,
+			}
+			return true
+		}
+
+		rest := key[1:]
+		common := commonPrefixLen(rest, c.prefix)
+
+		if common == len(c.prefix) {
+			// c's whole edge is consumed; keep descending into c.
+			n = c
+			key = rest[common:]
+			continue
+		}
+
+		// The key diverges partway through c's edge: split c into a new
+		// node covering the shared prefix, with c continuing below it.
+		split := &radixNode{
+			prefix:   append([]byte(nil), c.prefix[:common]...),
+			children: map[byte]*radixNode{c.prefix[common]: c},
+		}
+		c.prefix = append([]byte(nil), c.prefix[common+1:]...)
+		n.children[key[0]] = split
+
+		if common == len(rest) {
+			split.hasValue = true
+			split.value = e
+			return true
+		}
+
+		remainder := rest[common+1:]
+		split.children[rest[common]] = &radixNode{
+			prefix:   append([]byte(nil), remainder...),
+			children: map[byte]*radixNode{},
+			hasValue: true,
+			value:    e,
+		}
+		return true
+	}
+}
+
+// delete removes key, if present, and reports whether it was present. It
+// prunes childless, valueless nodes left behind, but does not re-merge a
+// node that ends up with a single remaining child.
+func (n *radixNode) delete(key []byte) bool {
+	if len(key) == 0 {
+		if !n.hasValue {
+			return false
+		}
+		n.hasValue = false
+		n.value = keyEntry{}
+		return true
+	}
+
+	c, ok := n.children[key[0]]
+	if !ok {
+		return false
+	}
+	rest := key[1:]
+	if len(rest) < len(c.prefix) || commonPrefixLen(rest, c.prefix) != len(c.prefix) {
+		return false
+	}
+
+	deleted := c.delete(rest[len(c.prefix):])
+	if deleted && !c.hasValue && len(c.children) == 0 {
+		delete(n.children, key[0])
+	}
+	return deleted
+}
+
+func (n *radixNode) scan(prefix []byte, fn func(key []byte, e keyEntry) bool) {
+	node := n
+	remaining := prefix
+
+	for len(remaining) > 0 {
+		c, ok := node.children[remaining[0]]
+		if !ok {
+			return
+		}
+
+		rest := remaining[1:]
+		if len(rest) <= len(c.prefix) {
+			if commonPrefixLen(rest, c.prefix) != len(rest) {
+				return
+			}
+			// The requested prefix ends inside (or exactly at) c's edge;
+			// every key under c qualifies.
+			base := append(append([]byte(nil), prefix...), c.prefix[len(rest):]...)
+			c.walk(base, fn)
+			return
+		}
+
+		if commonPrefixLen(rest, c.prefix) != len(c.prefix) {
+			return
+		}
+		node = c
+		remaining = rest[len(c.prefix):]
+	}
+
+	node.walk(append([]byte(nil), prefix...), fn)
+}
+
+// walk visits n and every descendant in sorted key order, where base is the
+// full key that leads to n.
+func (n *radixNode) walk(base []byte, fn func(key []byte, e keyEntry) bool) bool {
+	if n.hasValue {
+		if !fn(base, n.value) {
+			return false
+		}
+	}
+
+	firstBytes := make([]int, 0, len(n.children))
+	for b := range n.children {
+		firstBytes = append(firstBytes, int(b))
+	}
+	sort.Ints(firstBytes)
+
+	for _, bi := range firstBytes {
+		b := byte(bi)
+		c := n.children[b]
+		childKey := append(append(append([]byte(nil), base...), b), c.prefix...)
+		if !c.walk(childKey, fn) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package caskdb
+
+import "testing"
+
+func TestBatchCommitAppliesAllOps(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.Set("to-delete", "x"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	b := store.NewBatch()
+	b.Set("hamlet", "shakespeare")
+	b.Set("anna karenina", "tolstoy")
+	b.Delete("to-delete")
+
+	if err := b.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	if val, err := store.Get("hamlet"); err != nil || val != "shakespeare" {
+		t.Fatalf("Get(hamlet) = (%q, %v), want (\"shakespeare\", nil)", val, err)
+	}
+	if val, err := store.Get("anna karenina"); err != nil || val != "tolstoy" {
+		t.Fatalf("Get(anna karenina) = (%q, %v), want (\"tolstoy\", nil)", val, err)
+	}
+	if store.Has("to-delete") {
+		t.Fatal("Has(to-delete) = true after batched Delete, want false")
+	}
+	if store.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", store.Len())
+	}
+}
+
+func TestBatchCommitIsSingleAppend(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	sizeBefore := store.active.size
+
+	b := store.NewBatch()
+	for i := 0; i < 10; i++ {
+		b.Set(string(rune('a'+i)), "value")
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	if store.active.size == sizeBefore {
+		t.Fatal("Commit did not append anything")
+	}
+	if store.Len() != 10 {
+		t.Fatalf("Len() = %d, want 10", store.Len())
+	}
+
+	// The whole batch should have landed in a single append to the active
+	// datafile, i.e. no rotation happened mid-batch despite 10 records.
+	if len(store.immutable) != 0 {
+		t.Fatalf("len(immutable) = %d, want 0: a batch should not rotate mid-commit", len(store.immutable))
+	}
+}
+
+func TestEmptyBatchCommitIsNoOp(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	sizeBefore := store.active.size
+
+	b := store.NewBatch()
+	if err := b.Commit(); err != nil {
+		t.Fatalf("Commit of an empty batch: %v", err)
+	}
+
+	if store.active.size != sizeBefore {
+		t.Fatal("committing an empty batch wrote to the active datafile")
+	}
+}
@@ -0,0 +1,39 @@
+// Command caskdb-recover repairs a caskdb datafile that may have a
+// truncated or corrupt tail left over from a crash mid-write. It scans the
+// file sequentially and truncates it to the last valid record boundary.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	caskdb "github.com/sklarsa/go-caskdb"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s <datafile>\n", os.Args[0])
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	path := flag.Arg(0)
+
+	truncated, err := caskdb.RecoverFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caskdb-recover: %v\n", err)
+		os.Exit(1)
+	}
+
+	if truncated == 0 {
+		fmt.Printf("%s: no corruption found\n", path)
+		return
+	}
+
+	fmt.Printf("%s: truncated %d trailing byte(s) of a corrupt or incomplete record\n", path, truncated)
+}
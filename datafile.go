@@ -0,0 +1,145 @@
+package caskdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	dataFileExt = ".data"
+	hintFileExt = ".hint"
+)
+
+// dataFile is a single numbered file in a DiskStore's directory. Datafiles
+// are immutable once they stop being the active file: only the active
+// dataFile is ever appended to.
+type dataFile struct {
+	id   uint32
+	f    *os.File
+	size int64
+
+	// syncCount counts calls to sync that returned successfully. It exists
+	// so tests can tell a datafile that was actually fsynced apart from one
+	// that merely looks fine because the OS hasn't flushed its dirty pages
+	// yet; production code never reads it.
+	syncCount int
+}
+
+func dataFilePath(dir string, id uint32) string {
+	return filepath.Join(dir, fmt.Sprintf("%09d%s", id, dataFileExt))
+}
+
+func hintFilePath(dir string, id uint32) string {
+	return filepath.Join(dir, fmt.Sprintf("%09d%s", id, hintFileExt))
+}
+
+// createDataFile creates a brand new datafile with the given id and writes
+// its version preamble. It fails if the file already exists.
+func createDataFile(dir string, id uint32) (*dataFile, error) {
+	path := dataFilePath(dir, id)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write([]byte{fileFormatVersion}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &dataFile{id: id, f: f, size: preambleSize}, nil
+}
+
+// openDataFile opens a datafile that already exists on disk and validates
+// its version preamble. writable files are opened for append as well as
+// random-access reads; the rest are opened read-only.
+func openDataFile(dir string, id uint32, writable bool) (*dataFile, error) {
+	path := dataFilePath(dir, id)
+	flag := os.O_RDONLY
+	if writable {
+		flag = os.O_RDWR | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	version := make([]byte, preambleSize)
+	if _, err := f.ReadAt(version, 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading version of %s: %w", path, err)
+	}
+	if version[0] != fileFormatVersion {
+		f.Close()
+		return nil, fmt.Errorf("%s: unsupported datafile version %d, expected %d", path, version[0], fileFormatVersion)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &dataFile{id: id, f: f, size: fi.Size()}, nil
+}
+
+// append writes data to the end of the datafile and returns the offset it
+// was written at.
+func (df *dataFile) append(data []byte) (pos int64, err error) {
+	pos = df.size
+	n, err := df.f.Write(data)
+	if err != nil {
+		return 0, err
+	}
+	if n != len(data) {
+		return 0, fmt.Errorf("short write to datafile %d: wrote %d of %d bytes", df.id, n, len(data))
+	}
+	df.size += int64(n)
+	return pos, nil
+}
+
+// sync flushes the datafile's previously written data to stable storage.
+func (df *dataFile) sync() error {
+	if err := df.f.Sync(); err != nil {
+		return err
+	}
+	df.syncCount++
+	return nil
+}
+
+func (df *dataFile) readAt(buf []byte, pos int64) error {
+	_, err := df.f.ReadAt(buf, pos)
+	return err
+}
+
+func (df *dataFile) close() error {
+	return df.f.Close()
+}
+
+// listDataFileIDs returns the ids of every *.data file in dir, sorted
+// ascending. The highest id is the most recently created file.
+func listDataFileIDs(dir string) ([]uint32, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint32
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), dataFileExt) {
+			continue
+		}
+		idStr := strings.TrimSuffix(e.Name(), dataFileExt)
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint32(id))
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
@@ -0,0 +1,108 @@
+package caskdb
+
+import (
+	"os"
+	"testing"
+)
+
+// TestOpenDataFileRejectsMismatchedVersion checks that a datafile written
+// under an older (or newer) header layout, identified by its preamble byte,
+// is rejected rather than scanned with the current header size — which
+// would silently misinterpret its key/value offsets.
+func TestOpenDataFileRejectsMismatchedVersion(t *testing.T) {
+	dir := t.TempDir()
+	df, err := createDataFile(dir, 0)
+	if err != nil {
+		t.Fatalf("createDataFile: %v", err)
+	}
+	if err := df.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := dataFilePath(dir, 0)
+	if err := os.WriteFile(path, []byte{fileFormatVersion - 1}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openDataFile(dir, 0, false); err == nil {
+		t.Fatal("openDataFile did not reject a datafile with a mismatched version preamble")
+	}
+}
+
+// TestDiskStoreRotatesDataFiles checks that once the active datafile would
+// exceed MaxFileSize, writes land in a new datafile rather than growing the
+// old one indefinitely.
+func TestDiskStoreRotatesDataFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir, &Options{MaxFileSize: 64})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	for i := 0; i < 20; i++ {
+		if err := store.Set(string(rune('a'+i)), "some reasonably long value"); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+
+	if len(store.immutable) == 0 {
+		t.Fatal("expected at least one immutable datafile after exceeding MaxFileSize repeatedly, got none")
+	}
+
+	ids, err := listDataFileIDs(dir)
+	if err != nil {
+		t.Fatalf("listDataFileIDs: %v", err)
+	}
+	if len(ids) < 2 {
+		t.Fatalf("expected at least 2 datafiles on disk, got %d", len(ids))
+	}
+
+	for i := 0; i < 20; i++ {
+		key := string(rune('a' + i))
+		val, err := store.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		if val != "some reasonably long value" {
+			t.Errorf("Get(%q) = %q, want the original value", key, val)
+		}
+	}
+}
+
+func TestDiskStoreReopenAcrossMultipleDataFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir, &Options{MaxFileSize: 64})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+
+	want := map[string]string{}
+	for i := 0; i < 20; i++ {
+		key := string(rune('a' + i))
+		val := "value-" + key
+		if err := store.Set(key, val); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		want[key] = val
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := NewDiskStore(dir, &Options{MaxFileSize: 64})
+	if err != nil {
+		t.Fatalf("reopening NewDiskStore: %v", err)
+	}
+	defer reopened.Close()
+
+	for key, val := range want {
+		got, err := reopened.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		if got != val {
+			t.Errorf("Get(%q) = %q, want %q", key, got, val)
+		}
+	}
+}
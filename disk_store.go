@@ -2,8 +2,10 @@ package caskdb
 
 import (
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -33,23 +35,59 @@ import (
 //
 // Read the paper for more details: https://riak.com/assets/bitcask-intro.pdf
 //
-// DiskStore provides two simple operations to get and set key value pairs. Both key
-// and value need to be of string type, and all the data is persisted to disk.
-// During startup, DiskStorage loads all the existing KV pair metadata, and it will
-// throw an error if the file is invalid or corrupt.
+// Unlike the original single-file workshop version, DiskStore manages a directory
+// of numbered datafiles rather than one ever-growing file. Only one datafile, the
+// active one, is ever written to; once it reaches Options.MaxFileSize it is sealed
+// and a new active datafile is opened. keyEntry.fileId records which datafile a
+// given key's record lives in, so Get can dispatch reads to the right file.
 //
-// Note that if the database file is large, the initialisation will take time
-// accordingly. The initialisation is also a blocking operation; till it is completed,
-// we cannot use the database.
+// Sealed (immutable) datafiles accumulate dead space as keys are overwritten. Merge
+// reclaims that space by rewriting the live records from the immutable datafiles
+// into fresh, denser datafiles and discarding the old ones.
+//
+// NewDiskStore rebuilds the KeyDir by scanning the existing datafiles (or their
+// hint files, where Merge has produced one) before returning, so data written by
+// a previous process is visible right away. This is a blocking operation bounded
+// by Options.LoadTimeout; Options.LoadProgress can be set to observe its progress
+// on a large dataset.
+//
+// The KeyDir itself is an Index (see Options.Index); DiskStore only ever looks
+// entries up, inserts them and scans them through that interface, so swapping in
+// a different Index implementation does not require any other changes here.
+//
+// Set and Delete only guarantee that a record has been written to the
+// active datafile, not that it has survived a crash; Options.Sync controls
+// whether and how often that datafile is fsynced. Batch groups a sequence
+// of writes into a single append and, at most, a single fsync.
+//
+// DiskStore is safe for concurrent use by multiple goroutines: a single sync.RWMutex
+// guards the KeyDir and the set of open datafiles, so Get/Has/Len/Keys/Fold/Scan take
+// a read lock and run concurrently with each other, while Set/Delete/Merge/Close take
+// the write lock and run exclusively. Merge, in particular, holds the write lock for
+// its entire duration, so a large compaction will block other operations until it
+// finishes.
 //
 // Typical usage example:
 //
-//		store, _ := NewDiskStore("books.db")
+//		store, _ := NewDiskStore("books", nil)
 //	   	store.Set("othello", "shakespeare")
-//	   	author := store.Get("othello")
+//	   	author, _ := store.Get("othello")
 type DiskStore struct {
-	f      *os.File
-	curPos int64
+	dir         string
+	maxFileSize int64
+	nextID      uint32
+	active      *dataFile
+	immutable   map[uint32]*dataFile
+
+	mu    sync.RWMutex
+	index Index
+
+	syncPolicy SyncPolicy
+	syncStop   chan struct{}
+	syncDone   chan struct{}
+
+	expiryStop chan struct{}
+	expiryDone chan struct{}
 }
 
 func isFileExists(fileName string) bool {
@@ -60,84 +98,333 @@ func isFileExists(fileName string) bool {
 	return false
 }
 
-var keyDir map[string]keyEntry = map[string]keyEntry{}
+// NewDiskStore opens (or creates) a DiskStore backed by the datafiles in
+// dirPath. Pass nil to use DefaultOptions.
+func NewDiskStore(dirPath string, opts *Options) (*DiskStore, error) {
+	o := DefaultOptions()
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxFileSize <= 0 {
+		return nil, fmt.Errorf("MaxFileSize must be positive, got %d", o.MaxFileSize)
+	}
 
-func NewDiskStore(fileName string) (*DiskStore, error) {
-	var (
-		fi     os.FileInfo
-		err    error
-		f      *os.File
-		curPos int64
-	)
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return nil, err
+	}
 
-	fi, err = os.Stat(fileName)
-	if err != nil && errors.Is(err, fs.ErrExist) {
+	ids, err := listDataFileIDs(dirPath)
+	if err != nil {
 		return nil, err
 	}
 
-	if fi != nil {
-		curPos = fi.Size()
+	index := o.Index
+	if index == nil {
+		index = NewMapIndex()
+	}
+
+	d := &DiskStore{
+		dir:         dirPath,
+		maxFileSize: o.MaxFileSize,
+		immutable:   map[uint32]*dataFile{},
+		index:       index,
+		syncPolicy:  o.Sync,
+	}
+
+	if len(ids) == 0 {
+		active, err := createDataFile(dirPath, 0)
+		if err != nil {
+			return nil, err
+		}
+		d.active = active
+		d.nextID = 1
+		d.startSyncLoop()
+		d.startExpirySweep(o.ExpirySweepInterval)
+		return d, nil
+	}
+
+	for _, id := range ids[:len(ids)-1] {
+		df, err := openDataFile(dirPath, id, false)
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+		d.immutable[id] = df
+	}
+
+	activeID := ids[len(ids)-1]
+	active, err := openDataFile(dirPath, activeID, true)
+	if err != nil {
+		d.Close()
+		return nil, err
 	}
+	d.active = active
+	d.nextID = activeID + 1
 
-	if f, err = os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+	if err := d.rebuildKeyDir(o.LoadTimeout, o.LoadProgress); err != nil {
+		d.Close()
 		return nil, err
 	}
 
-	os.Stat(fileName)
+	d.startSyncLoop()
+	d.startExpirySweep(o.ExpirySweepInterval)
+	return d, nil
+}
 
-	return &DiskStore{
-		f:      f,
-		curPos: curPos,
-	}, nil
+// startSyncLoop launches the background fsync goroutine if d.syncPolicy is
+// a SyncInterval policy. It is a no-op for every other policy.
+func (d *DiskStore) startSyncLoop() {
+	if d.syncPolicy.mode != syncInterval {
+		return
+	}
+	d.syncStop = make(chan struct{})
+	d.syncDone = make(chan struct{})
+	go d.runSyncLoop(d.syncPolicy.interval, d.syncStop, d.syncDone)
 }
 
-func (d *DiskStore) Get(key string) string {
-	keyInfo, found := keyDir[key]
-	if !found {
-		return ""
+func (d *DiskStore) fileForID(id uint32) (*dataFile, error) {
+	if d.active != nil && id == d.active.id {
+		return d.active, nil
 	}
+	if df, ok := d.immutable[id]; ok {
+		return df, nil
+	}
+	return nil, fmt.Errorf("datafile %d is not open", id)
+}
 
-	buf := make([]byte, keyInfo.valueSize)
-	_, err := d.f.ReadAt(buf, keyInfo.valuePos)
+// readEntry reads and decodes the value described by entry. Callers must
+// already hold d.mu (for reading or writing).
+func (d *DiskStore) readEntry(entry keyEntry) (string, error) {
+	df, err := d.fileForID(entry.fileId)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	_, _, val := decodeKV(buf)
-	return val
+	buf := make([]byte, entry.valueSize)
+	if err := df.readAt(buf, entry.valuePos); err != nil {
+		return "", err
+	}
+
+	_, _, val, err := decodeKV(buf)
+	if err != nil {
+		return "", err
+	}
+	return val, nil
 }
 
-func (d *DiskStore) Set(key string, value string) {
-	timestamp := time.Now().Unix()
+// Get returns the value for key, or "" if key is not present or has
+// expired (see SetWithTTL, SetWithExpiry). An expired key is not removed
+// from the KeyDir by Get itself; that is the background sweeper's job (see
+// Options.ExpirySweepInterval), or it is dropped the next time Merge runs.
+func (d *DiskStore) Get(key string) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 
-	dataLen, data := encodeKV(
-		uint32(timestamp),
-		key,
-		value,
-	)
+	entry, found := d.index.Get([]byte(key))
+	if !found || isExpired(entry, uint32(time.Now().Unix())) {
+		return "", nil
+	}
 
-	written, err := d.f.Write(data)
+	val, err := d.readEntry(entry)
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("reading key %q: %w", key, err)
 	}
-	if written != dataLen {
-		panic("written != datalen")
+	return val, nil
+}
+
+// Has reports whether key is present and has not expired.
+func (d *DiskStore) Has(key string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	entry, found := d.index.Get([]byte(key))
+	return found && !isExpired(entry, uint32(time.Now().Unix()))
+}
+
+// Len returns the number of keys in the KeyDir, including any that have
+// expired but have not yet been dropped by the background sweeper
+// (Options.ExpirySweepInterval) or Merge.
+func (d *DiskStore) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.index.Len()
+}
+
+// Keys returns every live, unexpired key. Order depends on the configured
+// Index: it is unspecified for the default MapIndex, and sorted for
+// ARTIndex.
+func (d *DiskStore) Keys() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	now := uint32(time.Now().Unix())
+	keys := make([]string, 0, d.index.Len())
+	d.index.Scan(nil, func(key []byte, entry keyEntry) bool {
+		if !isExpired(entry, now) {
+			keys = append(keys, string(key))
+		}
+		return true
+	})
+	return keys
+}
+
+// Fold calls fn once for every live, unexpired key/value pair, stopping and
+// returning the first error fn (or reading its value) returns. Iteration
+// order depends on the configured Index.
+func (d *DiskStore) Fold(fn func(key, value string) error) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	now := uint32(time.Now().Unix())
+	var foldErr error
+	d.index.Scan(nil, func(key []byte, entry keyEntry) bool {
+		if isExpired(entry, now) {
+			return true
+		}
+		val, err := d.readEntry(entry)
+		if err != nil {
+			foldErr = fmt.Errorf("reading key %q: %w", key, err)
+			return false
+		}
+		if err := fn(string(key), val); err != nil {
+			foldErr = err
+			return false
+		}
+		return true
+	})
+	return foldErr
+}
+
+// Scan calls fn once for every live, unexpired key with the given prefix,
+// stopping and returning the first error fn (or reading its value)
+// returns. Iteration order depends on the configured Index.
+func (d *DiskStore) Scan(prefix string, fn func(key, value string) error) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	now := uint32(time.Now().Unix())
+	var scanErr error
+	d.index.Scan([]byte(prefix), func(key []byte, entry keyEntry) bool {
+		if isExpired(entry, now) {
+			return true
+		}
+		val, err := d.readEntry(entry)
+		if err != nil {
+			scanErr = fmt.Errorf("reading key %q: %w", key, err)
+			return false
+		}
+		if err := fn(string(key), val); err != nil {
+			scanErr = err
+			return false
+		}
+		return true
+	})
+	return scanErr
+}
+
+// rotate seals the active datafile and opens a new one, unless the active
+// datafile is still empty (in which case rotating would just create another
+// empty file, e.g. when a single record is larger than MaxFileSize). Callers
+// must already hold d.mu for writing.
+//
+// The outgoing datafile is fsynced before being sealed, regardless of
+// Options.Sync: once a datafile stops being active it is never appended to
+// again, so this is the only chance to flush its last dirty pages to stable
+// storage before Merge or a restart starts relying on its on-disk contents.
+func (d *DiskStore) rotate() error {
+	if d.active.size <= preambleSize {
+		return nil
 	}
 
-	keyDir[key] = keyEntry{
-		timestamp: uint32(timestamp),
-		valueSize: uint(dataLen),
-		valuePos:  d.curPos,
+	if err := d.active.sync(); err != nil {
+		return fmt.Errorf("sealing datafile %d: %w", d.active.id, err)
 	}
-	d.curPos += int64(dataLen)
 
+	d.immutable[d.active.id] = d.active
+
+	newActive, err := createDataFile(d.dir, d.nextID)
+	if err != nil {
+		return err
+	}
+	d.nextID++
+	d.active = newActive
+	return nil
 }
 
-func (d *DiskStore) Close() bool {
-	err := d.f.Close()
+// appendRecord rotates the active datafile if data would overflow
+// MaxFileSize, then appends data to it. Callers must already hold d.mu for
+// writing.
+func (d *DiskStore) appendRecord(data []byte) (pos int64, fileID uint32, err error) {
+	if d.active.size+int64(len(data)) > d.maxFileSize {
+		if err := d.rotate(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	pos, err = d.active.append(data)
 	if err != nil {
-		panic(err)
+		return 0, 0, err
 	}
+	return pos, d.active.id, nil
+}
+
+// Set stores value under key, overwriting any previous value. The key
+// never expires; see SetWithTTL and SetWithExpiry for keys that should.
+func (d *DiskStore) Set(key string, value string) error {
+	return d.setWithExpiry(key, value, 0)
+}
+
+// Delete removes key. Deleting a key that is not present is a no-op.
+func (d *DiskStore) Delete(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, found := d.index.Get([]byte(key)); !found {
+		return nil
+	}
+
+	timestamp := uint32(time.Now().Unix())
+	_, data := encodeTombstone(timestamp, key)
+
+	if _, _, err := d.appendRecord(data); err != nil {
+		return fmt.Errorf("deleting key %q: %w", key, err)
+	}
+	if err := d.syncLocked(); err != nil {
+		return fmt.Errorf("deleting key %q: %w", key, err)
+	}
+
+	d.index.Delete([]byte(key))
+	return nil
+}
 
-	return true
+// Close stops any background goroutines and closes every open datafile.
+func (d *DiskStore) Close() error {
+	// Stop the background goroutines before taking d.mu: they lock it
+	// themselves, so waiting for them to exit while already holding the
+	// lock would deadlock.
+	if d.syncStop != nil {
+		close(d.syncStop)
+		<-d.syncDone
+		d.syncStop = nil
+	}
+	if d.expiryStop != nil {
+		close(d.expiryStop)
+		<-d.expiryDone
+		d.expiryStop = nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var err error
+	if d.active != nil {
+		err = d.active.close()
+	}
+	for _, df := range d.immutable {
+		if cerr := df.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
 }
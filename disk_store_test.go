@@ -0,0 +1,184 @@
+package caskdb
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestDiskStoreSetGetDelete(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	if val, err := store.Get("missing"); err != nil || val != "" {
+		t.Fatalf("Get(missing) = (%q, %v), want (\"\", nil)", val, err)
+	}
+	if store.Has("missing") {
+		t.Fatal("Has(missing) = true, want false")
+	}
+
+	if err := store.Set("hamlet", "shakespeare"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if val, err := store.Get("hamlet"); err != nil || val != "shakespeare" {
+		t.Fatalf("Get(hamlet) = (%q, %v), want (\"shakespeare\", nil)", val, err)
+	}
+	if !store.Has("hamlet") {
+		t.Fatal("Has(hamlet) = false, want true")
+	}
+	if store.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", store.Len())
+	}
+
+	if err := store.Delete("hamlet"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if val, err := store.Get("hamlet"); err != nil || val != "" {
+		t.Fatalf("Get(hamlet) after Delete = (%q, %v), want (\"\", nil)", val, err)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("Len() after Delete = %d, want 0", store.Len())
+	}
+
+	// Deleting an already-missing key is a no-op, not an error.
+	if err := store.Delete("hamlet"); err != nil {
+		t.Fatalf("Delete of a missing key: %v", err)
+	}
+}
+
+func TestDiskStoreKeysFoldScan(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	want := map[string]string{
+		"app/1": "a",
+		"app/2": "b",
+		"zoo/1": "c",
+	}
+	for k, v := range want {
+		if err := store.Set(k, v); err != nil {
+			t.Fatalf("Set(%q): %v", k, err)
+		}
+	}
+
+	keys := store.Keys()
+	sort.Strings(keys)
+	var wantKeys []string
+	for k := range want {
+		wantKeys = append(wantKeys, k)
+	}
+	sort.Strings(wantKeys)
+	if fmt.Sprint(keys) != fmt.Sprint(wantKeys) {
+		t.Errorf("Keys() = %v, want %v", keys, wantKeys)
+	}
+
+	folded := map[string]string{}
+	if err := store.Fold(func(k, v string) error {
+		folded[k] = v
+		return nil
+	}); err != nil {
+		t.Fatalf("Fold: %v", err)
+	}
+	if fmt.Sprint(folded) != fmt.Sprint(want) {
+		t.Errorf("Fold visited %v, want %v", folded, want)
+	}
+
+	scanned := map[string]string{}
+	if err := store.Scan("app/", func(k, v string) error {
+		scanned[k] = v
+		return nil
+	}); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	wantScanned := map[string]string{"app/1": "a", "app/2": "b"}
+	if fmt.Sprint(scanned) != fmt.Sprint(wantScanned) {
+		t.Errorf("Scan(\"app/\") visited %v, want %v", scanned, wantScanned)
+	}
+}
+
+func TestDiskStoreWithARTIndex(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), &Options{MaxFileSize: 128 * 1024 * 1024, Index: NewARTIndex()})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	for _, k := range []string{"banana", "apple", "app"} {
+		if err := store.Set(k, "v-"+k); err != nil {
+			t.Fatalf("Set(%q): %v", k, err)
+		}
+	}
+
+	keys := store.Keys()
+	want := []string{"app", "apple", "banana"}
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("Keys() with ARTIndex = %v, want sorted %v", keys, want)
+	}
+}
+
+func TestDiskStoreIndependentKeyDirsPerStore(t *testing.T) {
+	store1, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store1.Close()
+
+	store2, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store2.Close()
+
+	if err := store1.Set("key", "from-store1"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if val, err := store2.Get("key"); err != nil || val != "" {
+		t.Fatalf("store2.Get(key) = (%q, %v), want (\"\", nil); stores must not share a KeyDir", val, err)
+	}
+}
+
+// TestDiskStoreConcurrentAccess exercises Set/Get/Delete/Fold from many
+// goroutines at once. Run with -race to catch any unsynchronised access to
+// the KeyDir or open datafiles.
+func TestDiskStoreConcurrentAccess(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), &Options{MaxFileSize: 4096})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	const goroutines = 8
+	const opsPerGoroutine = 100
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < opsPerGoroutine; i++ {
+				key := fmt.Sprintf("key-%d-%d", g, i%10)
+				if err := store.Set(key, fmt.Sprintf("val-%d", i)); err != nil {
+					t.Errorf("Set(%q): %v", key, err)
+				}
+				if _, err := store.Get(key); err != nil {
+					t.Errorf("Get(%q): %v", key, err)
+				}
+				if i%7 == 0 {
+					if err := store.Delete(key); err != nil {
+						t.Errorf("Delete(%q): %v", key, err)
+					}
+				}
+				store.Len()
+				store.Keys()
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -1,6 +1,9 @@
 package caskdb
 
 import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
 	"unicode/utf8"
 )
 
@@ -38,96 +41,151 @@ import (
 //For the workshop, the functions will have the following signature:
 //
 //    func encodeKV(timestamp uint32, key string, value string) (int, []byte)
-//    func decodeKV(data []byte) (uint32, string, string)
+//    func decodeKV(data []byte) (header, string, string, error)
 
 // headerSize specifies the total header size. Our key value pair, when stored on disk
 // looks like this:
 //
-//	┌───────────┬──────────┬────────────┬─────┬───────┐
-//	│ timestamp │ key_size │ value_size │ key │ value │
-//	└───────────┴──────────┴────────────┴─────┴───────┘
+//	┌───────────┬──────────┬────────────┬─────────────┬────────┬─────┬─────┬───────┐
+//	│ timestamp │ key_size │ value_size │ record_type │ expiry │ crc │ key │ value │
+//	└───────────┴──────────┴────────────┴─────────────┴────────┴─────┴─────┴───────┘
 //
 // This is analogous to a typical database's row (or a record). The total length of
 // the row is variable, depending on the contents of the key and value.
 //
-// The first three fields form the header:
+// The first six fields form the header:
 //
-//	┌───────────────┬──────────────┬────────────────┐
-//	│ timestamp(4B) │ key_size(4B) │ value_size(4B) │
-//	└───────────────┴──────────────┴────────────────┘
+//	┌───────────────┬──────────────┬────────────────┬─────────────────┬──────────────┬─────────┐
+//	│ timestamp(4B) │ key_size(4B) │ value_size(4B) │ record_type(4B) │ expiry(4B) │ crc(4B) │
+//	└───────────────┴──────────────┴────────────────┴─────────────────┴──────────────┴─────────┘
 //
-// These three fields store unsigned integers of size 4 bytes, giving our header a
-// fixed length of 12 bytes. Timestamp field stores the time the record we
+// These six fields store unsigned integers of size 4 bytes, giving our header a
+// fixed length of 24 bytes. Timestamp field stores the time the record we
 // inserted in unix epoch seconds. Key size and value size fields store the length of
-// bytes occupied by the key and value. The maximum integer
-// stored by 4 bytes is 4,294,967,295 (2 ** 32 - 1), roughly ~4.2GB. So, the size of
-// each key or value cannot exceed this. Theoretically, a single row can be as large
-// as ~8.4GB.
-const headerSize = 12
+// bytes occupied by the key and value. record_type distinguishes a normal record
+// (recordTypePut) from a tombstone written by Delete (recordTypeTombstone). expiry
+// is the unix time in seconds at which the record expires, or 0 if it never does;
+// see SetWithTTL and SetWithExpiry. The maximum integer stored by 4 bytes is
+// 4,294,967,295 (2 ** 32 - 1), roughly ~4.2GB. So, the size of each key or value
+// cannot exceed this. Theoretically, a single row can be as large as ~8.4GB.
+//
+// crc is the IEEE CRC32 checksum of timestamp, key_size, value_size, record_type,
+// expiry, key and value (i.e. the whole record except the crc field itself). It
+// lets us detect a record that was only partially written to disk, e.g. because
+// the process crashed mid-write. See RecoverFile for how a datafile with a
+// corrupt tail is repaired.
+const headerSize = 24
+
+// Every datafile starts with a 1-byte preamble holding the file format
+// version, so that a process opening an older or newer datafile can detect
+// the mismatch instead of misinterpreting the records that follow.
+//
+//	┌─────────────┬────────┬────────┬─────┐
+//	│ version(1B) │ record │ record │ ... │
+//	└─────────────┴────────┴────────┴─────┘
+const (
+	preambleSize = 1
+
+	// fileFormatVersion is 3: version 1 records did not have a record_type
+	// field (there was no way to delete a key, so nothing to distinguish a
+	// record from), and version 2 records did not have an expiry field.
+	// NewDiskStore refuses to open a datafile or hint file whose preamble
+	// doesn't match, rather than misinterpreting its records.
+	fileFormatVersion = 3
+)
 
 // keyEntry keeps the metadata about the KV, specially the position of
 // the byte offset in the file. Whenever we insert/update a key, we create a new
 // keyEntry object and insert that into keyDir.
 type keyEntry struct {
-	fileId    uint // todo: use later when we do multi file stuff
+	fileId    uint32 // which datafile this record lives in
 	valueSize uint
 	valuePos  int64
 	timestamp uint32
+	expiry    uint32 // unix seconds the record expires at, or 0 if it never does
 }
 
-func NewKeyEntry(timestamp uint32, position uint32, totalSize uint32) keyEntry {
-	panic("implement me")
+func encodeKV(timestamp uint32, key string, value string) (int, []byte) {
+	return encodeRecord(timestamp, recordTypePut, key, value, 0)
 }
 
-func encodeHeader(timestamp uint32, keySize uint32, valueSize uint32) []byte {
-	buf := make([]byte, 12)
-	header{
-		timestamp: timestamp,
-		keySize:   keySize,
-		valueSize: valueSize,
-	}.WriteBytes(buf)
-	return buf
+// encodeKVWithExpiry is encodeKV for a record that should be treated as
+// deleted once expiry (a unix timestamp in seconds) has passed. expiry of 0
+// means the record never expires, same as encodeKV.
+func encodeKVWithExpiry(timestamp uint32, key string, value string, expiry uint32) (int, []byte) {
+	return encodeRecord(timestamp, recordTypePut, key, value, expiry)
 }
 
-func decodeHeader(header []byte) (uint32, uint32, uint32) {
-	h, err := headerFromBytes(header)
-	if err != nil {
-		panic(err)
-	}
-	return h.timestamp, h.keySize, h.valueSize
+// encodeTombstone encodes a Delete marker for key: a record with no
+// meaningful value that a KeyDir rebuild recognises and uses to forget any
+// earlier record for the same key.
+func encodeTombstone(timestamp uint32, key string) (int, []byte) {
+	return encodeRecord(timestamp, recordTypeTombstone, key, "", 0)
 }
 
-func encodeKV(timestamp uint32, key string, value string) (int, []byte) {
+func encodeRecord(timestamp uint32, rt recordType, key string, value string, expiry uint32) (int, []byte) {
 	h := header{
-		timestamp: timestamp,
-		keySize:   uint32(len(key)),
-		valueSize: uint32(len(value)),
+		timestamp:  timestamp,
+		keySize:    uint32(len(key)),
+		valueSize:  uint32(len(value)),
+		recordType: rt,
+		expiry:     expiry,
 	}
 
 	buf := make([]byte, h.KeyLen())
 
-	// Write Header
-	h.WriteBytes(buf)
-
 	// Write Key
 	for i, val := range key {
-		utf8.EncodeRune(buf[12+i:], val)
+		utf8.EncodeRune(buf[headerSize+i:], val)
 	}
 
 	// Write value
 	for i, val := range value {
-		utf8.EncodeRune(buf[12+int(h.keySize)+i:], val)
+		utf8.EncodeRune(buf[headerSize+int(h.keySize)+i:], val)
 	}
 
+	// The crc covers everything but itself, so compute it over the payload
+	// before writing the header (which includes the crc field) in front of it.
+	h.crc = recordChecksum(h, buf[headerSize:])
+
+	// Write Header
+	h.WriteBytes(buf)
+
 	return len(buf), buf
 
 }
 
-func decodeKV(data []byte) (uint32, string, string) {
-	header, err := headerFromBytes(data[:12])
+func decodeKV(data []byte) (header, string, string, error) {
+	h, err := headerFromBytes(data[:headerSize])
 	if err != nil {
-		panic(err)
+		return header{}, "", "", err
+	}
+
+	payload := data[headerSize:]
+	if uint32(len(payload)) != h.keySize+h.valueSize {
+		return header{}, "", "", fmt.Errorf("corrupt record: expected %d bytes of key+value, got %d", h.keySize+h.valueSize, len(payload))
 	}
 
-	return header.timestamp, string(data[12 : 12+header.keySize]), string(data[12+header.keySize:])
+	if crc := recordChecksum(h, payload); crc != h.crc {
+		return header{}, "", "", fmt.Errorf("corrupt record: crc mismatch, expected %d, got %d", h.crc, crc)
+	}
+
+	return h, string(payload[:h.keySize]), string(payload[h.keySize:]), nil
+}
+
+// recordChecksum computes the CRC32 (IEEE) checksum covering the timestamp,
+// keySize, valueSize, recordType and expiry fields of h plus the key and
+// value bytes in payload. The crc field of h itself is not part of the
+// checksum.
+func recordChecksum(h header, payload []byte) uint32 {
+	c := crc32.NewIEEE()
+	hdr := make([]byte, headerSize-4)
+	binary.LittleEndian.PutUint32(hdr, h.timestamp)
+	binary.LittleEndian.PutUint32(hdr[4:], h.keySize)
+	binary.LittleEndian.PutUint32(hdr[8:], h.valueSize)
+	binary.LittleEndian.PutUint32(hdr[12:], uint32(h.recordType))
+	binary.LittleEndian.PutUint32(hdr[16:], h.expiry)
+	c.Write(hdr)
+	c.Write(payload)
+	return c.Sum32()
 }
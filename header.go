@@ -5,32 +5,59 @@ import (
 	"fmt"
 )
 
+// recordType distinguishes a normal record from a tombstone written by
+// Delete. Tombstones carry no meaningful value bytes; they exist purely so
+// that a KeyDir rebuilt from a datafile scan knows a key was deleted after
+// the record that last set it.
+type recordType uint32
+
+const (
+	recordTypePut       recordType = 0
+	recordTypeTombstone recordType = 1
+)
+
+// header is stored on disk immediately before the key and value bytes. crc
+// holds the CRC32 (IEEE polynomial) checksum of the rest of the header
+// (timestamp, keySize, valueSize, recordType, expiry) plus the key and
+// value bytes, and is populated by encodeKV/WriteBytes so that decodeKV can
+// detect a corrupt or partially-written record. expiry is the unix time,
+// in seconds, at which the record should be treated as deleted; 0 means it
+// never expires.
 type header struct {
-	timestamp uint32
-	keySize   uint32
-	valueSize uint32
+	timestamp  uint32
+	keySize    uint32
+	valueSize  uint32
+	recordType recordType
+	expiry     uint32
+	crc        uint32
 }
 
 func (h header) WriteBytes(buf []byte) []byte {
-	// assumes len(buf) >= 12
+	// assumes len(buf) >= headerSize
 	binary.LittleEndian.PutUint32(buf, h.timestamp)
 	binary.LittleEndian.PutUint32(buf[4:], h.keySize)
 	binary.LittleEndian.PutUint32(buf[8:], h.valueSize)
+	binary.LittleEndian.PutUint32(buf[12:], uint32(h.recordType))
+	binary.LittleEndian.PutUint32(buf[16:], h.expiry)
+	binary.LittleEndian.PutUint32(buf[20:], h.crc)
 	return buf
 }
 
 func (h header) KeyLen() int {
-	return 12 + int(h.keySize) + int(h.valueSize)
+	return headerSize + int(h.keySize) + int(h.valueSize)
 }
 
 func headerFromBytes(buf []byte) (h header, err error) {
-	if len(buf) != 12 {
-		return h, fmt.Errorf("invalid header size: %d bytes. Expected 12", len(buf))
+	if len(buf) != headerSize {
+		return h, fmt.Errorf("invalid header size: %d bytes. Expected %d", len(buf), headerSize)
 	}
 
 	return header{
-		timestamp: binary.LittleEndian.Uint32(buf[:4]),
-		keySize:   binary.LittleEndian.Uint32(buf[4:8]),
-		valueSize: binary.LittleEndian.Uint32(buf[8:12]),
+		timestamp:  binary.LittleEndian.Uint32(buf[:4]),
+		keySize:    binary.LittleEndian.Uint32(buf[4:8]),
+		valueSize:  binary.LittleEndian.Uint32(buf[8:12]),
+		recordType: recordType(binary.LittleEndian.Uint32(buf[12:16])),
+		expiry:     binary.LittleEndian.Uint32(buf[16:20]),
+		crc:        binary.LittleEndian.Uint32(buf[20:24]),
 	}, nil
 }
@@ -0,0 +1,47 @@
+package caskdb
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+// A hint file is a companion to a merged datafile: for every live record it
+// stores the record's header fields plus the key, but not the value, so
+// that rebuilding the KeyDir on startup only requires reading a file
+// proportional to the number of live keys rather than the full datafile.
+//
+//	┌───────────────┬──────────────┬────────────────┬────────────────┬─────────────┬─────┐
+//	│ timestamp(4B) │ key_size(4B) │ value_size(4B) │ value_pos(8B) │ expiry(4B) │ key │
+//	└───────────────┴──────────────┴────────────────┴────────────────┴─────────────┴─────┘
+const hintHeaderSize = 24
+
+// encodeHintEntry serialises a single hint record. valuePos and valueSize
+// describe where the full record (header + key + value) lives in the
+// corresponding merged datafile. expiry is the record's expiry timestamp
+// (0 meaning it never expires), copied straight from its keyEntry.
+func encodeHintEntry(timestamp uint32, valuePos int64, valueSize uint32, expiry uint32, key string) []byte {
+	buf := make([]byte, hintHeaderSize+len(key))
+	binary.LittleEndian.PutUint32(buf[0:], timestamp)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(buf[8:], valueSize)
+	binary.LittleEndian.PutUint64(buf[12:], uint64(valuePos))
+	binary.LittleEndian.PutUint32(buf[20:], expiry)
+	copy(buf[hintHeaderSize:], key)
+	return buf
+}
+
+// writeHintFile writes a hint file containing entries (the concatenation of
+// zero or more encodeHintEntry results) for the merged datafile id.
+func writeHintFile(dir string, id uint32, entries []byte) error {
+	f, err := os.OpenFile(hintFilePath(dir, id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte{fileFormatVersion}); err != nil {
+		return err
+	}
+	_, err = f.Write(entries)
+	return err
+}
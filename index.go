@@ -0,0 +1,62 @@
+package caskdb
+
+import "strings"
+
+// Index is the in-memory structure that maps a key to the keyEntry
+// describing where its value lives on disk. DiskStore delegates all of its
+// KeyDir bookkeeping to an Index, chosen via Options.Index, so callers can
+// trade off memory use and iteration order for their workload without
+// DiskStore itself changing.
+//
+// DiskStore guards its Index with its own sync.RWMutex: Put and Delete never
+// run concurrently with any other call, but Get, Scan and Len may run
+// concurrently with each other, so implementations need only be safe for
+// concurrent read-only use.
+type Index interface {
+	Get(key []byte) (keyEntry, bool)
+	Put(key []byte, e keyEntry)
+	Delete(key []byte)
+	Scan(prefix []byte, fn func(key []byte, e keyEntry) bool)
+	Len() int
+}
+
+// MapIndex is the default Index: a plain Go map. Lookups are O(1), but Scan
+// visits keys in unspecified order and every key is stored in full, with no
+// sharing between keys that have a common prefix.
+type MapIndex struct {
+	m map[string]keyEntry
+}
+
+// NewMapIndex returns an empty MapIndex.
+func NewMapIndex() *MapIndex {
+	return &MapIndex{m: map[string]keyEntry{}}
+}
+
+func (idx *MapIndex) Get(key []byte) (keyEntry, bool) {
+	e, ok := idx.m[string(key)]
+	return e, ok
+}
+
+func (idx *MapIndex) Put(key []byte, e keyEntry) {
+	idx.m[string(key)] = e
+}
+
+func (idx *MapIndex) Delete(key []byte) {
+	delete(idx.m, string(key))
+}
+
+func (idx *MapIndex) Len() int {
+	return len(idx.m)
+}
+
+func (idx *MapIndex) Scan(prefix []byte, fn func(key []byte, e keyEntry) bool) {
+	p := string(prefix)
+	for k, e := range idx.m {
+		if !strings.HasPrefix(k, p) {
+			continue
+		}
+		if !fn([]byte(k), e) {
+			return
+		}
+	}
+}
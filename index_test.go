@@ -0,0 +1,141 @@
+package caskdb
+
+import (
+	"sort"
+	"testing"
+)
+
+// indexImpls is every Index implementation this suite runs the shared
+// behavioural tests against.
+func indexImpls() map[string]func() Index {
+	return map[string]func() Index{
+		"MapIndex": func() Index { return NewMapIndex() },
+		"ARTIndex": func() Index { return NewARTIndex() },
+	}
+}
+
+func TestIndexGetPutDelete(t *testing.T) {
+	for name, newIndex := range indexImpls() {
+		t.Run(name, func(t *testing.T) {
+			idx := newIndex()
+
+			if _, ok := idx.Get([]byte("hamlet")); ok {
+				t.Fatal("Get on empty index found a value")
+			}
+
+			idx.Put([]byte("hamlet"), keyEntry{valuePos: 1})
+			idx.Put([]byte("hamlet"), keyEntry{valuePos: 2})
+
+			e, ok := idx.Get([]byte("hamlet"))
+			if !ok || e.valuePos != 2 {
+				t.Fatalf("Get(hamlet) = (%+v, %v), want the overwritten entry", e, ok)
+			}
+			if idx.Len() != 1 {
+				t.Fatalf("Len() = %d, want 1 (Put of an existing key must not grow it)", idx.Len())
+			}
+
+			idx.Delete([]byte("hamlet"))
+			if _, ok := idx.Get([]byte("hamlet")); ok {
+				t.Fatal("Get found a value after Delete")
+			}
+			if idx.Len() != 0 {
+				t.Fatalf("Len() after Delete = %d, want 0", idx.Len())
+			}
+
+			// Deleting a missing key must not panic or go negative.
+			idx.Delete([]byte("missing"))
+			if idx.Len() != 0 {
+				t.Fatalf("Len() after deleting a missing key = %d, want 0", idx.Len())
+			}
+		})
+	}
+}
+
+func TestIndexScanWithPrefix(t *testing.T) {
+	for name, newIndex := range indexImpls() {
+		t.Run(name, func(t *testing.T) {
+			idx := newIndex()
+			for _, k := range []string{"app", "apple", "application", "banana"} {
+				idx.Put([]byte(k), keyEntry{})
+			}
+
+			var got []string
+			idx.Scan([]byte("app"), func(key []byte, e keyEntry) bool {
+				got = append(got, string(key))
+				return true
+			})
+			sort.Strings(got)
+			want := []string{"app", "apple", "application"}
+			if len(got) != len(want) {
+				t.Fatalf("Scan(\"app\") = %v, want %v", got, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("Scan(\"app\") = %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexScanCanStopEarly(t *testing.T) {
+	for name, newIndex := range indexImpls() {
+		t.Run(name, func(t *testing.T) {
+			idx := newIndex()
+			for _, k := range []string{"a", "b", "c", "d"} {
+				idx.Put([]byte(k), keyEntry{})
+			}
+
+			visited := 0
+			idx.Scan(nil, func(key []byte, e keyEntry) bool {
+				visited++
+				return false
+			})
+			if visited != 1 {
+				t.Fatalf("Scan visited %d entries after fn returned false, want 1", visited)
+			}
+		})
+	}
+}
+
+// TestARTIndexScanIsSorted checks the property MapIndex does not promise:
+// ARTIndex.Scan visits keys in sorted order.
+func TestARTIndexScanIsSorted(t *testing.T) {
+	idx := NewARTIndex()
+	for _, k := range []string{"banana", "apple", "cherry", "app", "apricot"} {
+		idx.Put([]byte(k), keyEntry{})
+	}
+
+	var got []string
+	idx.Scan(nil, func(key []byte, e keyEntry) bool {
+		got = append(got, string(key))
+		return true
+	})
+
+	want := append([]string(nil), got...)
+	sort.Strings(want)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("ARTIndex.Scan order = %v, want sorted %v", got, want)
+		}
+	}
+}
+
+// TestARTIndexSharedPrefixSplit exercises the edge-split path of the radix
+// tree: inserting a key that diverges partway through an existing edge.
+func TestARTIndexSharedPrefixSplit(t *testing.T) {
+	idx := NewARTIndex()
+	idx.Put([]byte("team"), keyEntry{valuePos: 1})
+	idx.Put([]byte("test"), keyEntry{valuePos: 2})
+	idx.Put([]byte("te"), keyEntry{valuePos: 3})
+
+	for k, want := range map[string]int64{"team": 1, "test": 2, "te": 3} {
+		e, ok := idx.Get([]byte(k))
+		if !ok || e.valuePos != want {
+			t.Fatalf("Get(%q) = (%+v, %v), want valuePos %d", k, e, ok, want)
+		}
+	}
+	if idx.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", idx.Len())
+	}
+}
@@ -0,0 +1,167 @@
+package caskdb
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Merge compacts every immutable datafile: it keeps only the latest live
+// value for each key (using the in-memory KeyDir as the source of truth for
+// what is live), rewrites those records into fresh datafiles, writes a hint
+// file alongside each one, and then removes the old datafiles. The active
+// datafile is never merged, since it is still being written to.
+//
+// Merge also drops any already-expired key it encounters from the KeyDir,
+// whether or not it is otherwise live: this, rather than anything the
+// background sweeper does, is what actually reclaims the disk space an
+// expired key occupied.
+//
+// Merge holds the DiskStore's write lock for its entire duration, so it
+// runs exclusively of Get/Set/Delete/Fold/Scan; a large compaction will
+// block other operations until it finishes.
+func (d *DiskStore) Merge() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	mergingIDs := make([]uint32, 0, len(d.immutable))
+	for id := range d.immutable {
+		mergingIDs = append(mergingIDs, id)
+	}
+	if len(mergingIDs) == 0 {
+		return nil
+	}
+	sort.Slice(mergingIDs, func(i, j int) bool { return mergingIDs[i] < mergingIDs[j] })
+
+	mergingSet := make(map[uint32]bool, len(mergingIDs))
+	for _, id := range mergingIDs {
+		mergingSet[id] = true
+	}
+
+	type liveKey struct {
+		key   string
+		entry keyEntry
+	}
+	now := uint32(time.Now().Unix())
+
+	var live []liveKey
+	var expired []string
+	d.index.Scan(nil, func(key []byte, entry keyEntry) bool {
+		if isExpired(entry, now) {
+			expired = append(expired, string(key))
+			return true
+		}
+		if mergingSet[entry.fileId] {
+			live = append(live, liveKey{string(key), entry})
+		}
+		return true
+	})
+	for _, key := range expired {
+		d.index.Delete([]byte(key))
+	}
+	// Process in a deterministic order to make merged output reproducible.
+	sort.Slice(live, func(i, j int) bool { return live[i].key < live[j].key })
+
+	var newFiles []*dataFile
+	hintData := map[uint32][]byte{}
+	newEntries := make(map[string]keyEntry, len(live))
+
+	var cur *dataFile
+	startNewFile := func() error {
+		f, err := createDataFile(d.dir, d.nextID)
+		if err != nil {
+			return err
+		}
+		d.nextID++
+		cur = f
+		newFiles = append(newFiles, f)
+		return nil
+	}
+
+	cleanupNewFiles := func() {
+		for _, f := range newFiles {
+			f.close()
+			os.Remove(dataFilePath(d.dir, f.id))
+		}
+	}
+
+	if err := startNewFile(); err != nil {
+		return err
+	}
+
+	for _, lk := range live {
+		srcFile, err := d.fileForID(lk.entry.fileId)
+		if err != nil {
+			cleanupNewFiles()
+			return fmt.Errorf("merge: %w", err)
+		}
+
+		buf := make([]byte, lk.entry.valueSize)
+		if err := srcFile.readAt(buf, lk.entry.valuePos); err != nil {
+			cleanupNewFiles()
+			return fmt.Errorf("merge: reading %q: %w", lk.key, err)
+		}
+		// Everything reachable from d.index is, by construction, a live
+		// Put record, so the decoded header itself is uninteresting here.
+		_, key, value, err := decodeKV(buf)
+		if err != nil {
+			cleanupNewFiles()
+			return fmt.Errorf("merge: decoding %q: %w", lk.key, err)
+		}
+		if key != lk.key {
+			cleanupNewFiles()
+			return fmt.Errorf("merge: key mismatch, expected %q, got %q", lk.key, key)
+		}
+
+		recordLen, record := encodeKVWithExpiry(lk.entry.timestamp, key, value, lk.entry.expiry)
+		if cur.size+int64(recordLen) > d.maxFileSize {
+			if err := startNewFile(); err != nil {
+				cleanupNewFiles()
+				return err
+			}
+		}
+
+		pos, err := cur.append(record)
+		if err != nil {
+			cleanupNewFiles()
+			return err
+		}
+
+		newEntries[key] = keyEntry{
+			fileId:    cur.id,
+			valuePos:  pos,
+			valueSize: uint(recordLen),
+			timestamp: lk.entry.timestamp,
+			expiry:    lk.entry.expiry,
+		}
+		hintData[cur.id] = append(hintData[cur.id], encodeHintEntry(lk.entry.timestamp, pos, uint32(recordLen), lk.entry.expiry, key)...)
+	}
+
+	for _, f := range newFiles {
+		if err := writeHintFile(d.dir, f.id, hintData[f.id]); err != nil {
+			cleanupNewFiles()
+			return fmt.Errorf("merge: writing hint file for datafile %d: %w", f.id, err)
+		}
+	}
+
+	// Everything that could fail has succeeded; swap the KeyDir entries and
+	// old datafiles over to the merged ones.
+	for key, entry := range newEntries {
+		d.index.Put([]byte(key), entry)
+	}
+
+	for _, id := range mergingIDs {
+		old := d.immutable[id]
+		delete(d.immutable, id)
+		old.close()
+		os.Remove(dataFilePath(d.dir, id))
+		os.Remove(hintFilePath(d.dir, id))
+	}
+
+	for _, f := range newFiles {
+		d.immutable[f.id] = f
+	}
+
+	return nil
+}
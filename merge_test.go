@@ -0,0 +1,130 @@
+package caskdb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestMergeReclaimsSpace overwrites the same keys many times to build up
+// dead space across several immutable datafiles, then checks that Merge
+// shrinks the on-disk footprint while preserving the latest value of every
+// key.
+func TestMergeReclaimsSpace(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir, &Options{MaxFileSize: 256})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	const keys = 5
+	for round := 0; round < 30; round++ {
+		for k := 0; k < keys; k++ {
+			key := fmt.Sprintf("key-%d", k)
+			val := fmt.Sprintf("value-%d-round-%d", k, round)
+			if err := store.Set(key, val); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+		}
+	}
+
+	sizeBefore, err := dirSize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Merge(); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	sizeAfter, err := dirSize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizeAfter >= sizeBefore {
+		t.Errorf("Merge did not shrink the datafiles: before %d bytes, after %d bytes", sizeBefore, sizeAfter)
+	}
+
+	for k := 0; k < keys; k++ {
+		key := fmt.Sprintf("key-%d", k)
+		want := fmt.Sprintf("value-%d-round-%d", k, 29)
+		got, err := store.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		if got != want {
+			t.Errorf("Get(%q) = %q after Merge, want %q", key, got, want)
+		}
+	}
+}
+
+// TestMergeSurvivesRestart checks that the merged, hint-file-backed
+// datafiles still reconstruct the correct KeyDir after the store is closed
+// and reopened.
+func TestMergeSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir, &Options{MaxFileSize: 256})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+
+	for round := 0; round < 10; round++ {
+		for k := 0; k < 5; k++ {
+			key := fmt.Sprintf("key-%d", k)
+			val := fmt.Sprintf("value-%d-round-%d", k, round)
+			if err := store.Set(key, val); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+		}
+	}
+	if err := store.Delete("key-2"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Merge(); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := NewDiskStore(dir, &Options{MaxFileSize: 256})
+	if err != nil {
+		t.Fatalf("reopening NewDiskStore: %v", err)
+	}
+	defer reopened.Close()
+
+	for k := 0; k < 5; k++ {
+		key := fmt.Sprintf("key-%d", k)
+		got, err := reopened.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		if k == 2 {
+			if got != "" {
+				t.Errorf("Get(%q) = %q after Merge+restart, want deleted key to stay gone", key, got)
+			}
+			continue
+		}
+		want := fmt.Sprintf("value-%d-round-%d", k, 9)
+		if got != want {
+			t.Errorf("Get(%q) = %q after Merge+restart, want %q", key, got, want)
+		}
+	}
+}
+
+func dirSize(dir string) (int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return 0, err
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
@@ -0,0 +1,47 @@
+package caskdb
+
+import "time"
+
+// Options configures a DiskStore. The zero value is not directly usable;
+// start from DefaultOptions and override the fields you care about.
+type Options struct {
+	// MaxFileSize is the size, in bytes, at which the active datafile is
+	// closed, marked immutable, and a new active datafile is opened. It
+	// bounds how much a single Merge pass has to rewrite and how long a
+	// single datafile scan takes during startup.
+	MaxFileSize int64
+
+	// LoadTimeout bounds how long NewDiskStore spends rebuilding the KeyDir
+	// from the datafiles on disk. Zero means no timeout.
+	LoadTimeout time.Duration
+
+	// LoadProgress, if set, is called after each datafile (or hint file) is
+	// scanned while rebuilding the KeyDir, reporting how many of the total
+	// datafiles have been scanned so far. Useful for surfacing progress on
+	// large datasets.
+	LoadProgress func(filesScanned, totalFiles int)
+
+	// Index selects the in-memory KeyDir implementation. Nil means
+	// NewMapIndex(). See ARTIndex for an ordered alternative.
+	Index Index
+
+	// Sync controls when the active datafile is fsynced. The zero value is
+	// SyncNone. See SyncNone, SyncAlways and SyncInterval.
+	Sync SyncPolicy
+
+	// ExpirySweepInterval, if positive, starts a background goroutine that
+	// walks the KeyDir every interval, dropping any key whose TTL (see
+	// SetWithTTL, SetWithExpiry) has passed. Zero disables the sweeper;
+	// expired keys are still treated as missing by Get, and are still
+	// reclaimed on disk by the next Merge, but until a sweep or a Merge
+	// drops them they still count towards the KeyDir's size (and Len).
+	ExpirySweepInterval time.Duration
+}
+
+// DefaultOptions returns the Options used by NewDiskStore when called with
+// a nil *Options.
+func DefaultOptions() Options {
+	return Options{
+		MaxFileSize: 128 * 1024 * 1024, // 128MB
+	}
+}
@@ -0,0 +1,80 @@
+package caskdb
+
+import (
+	"fmt"
+	"os"
+)
+
+// RecoverFile scans the datafile at path sequentially, record by record,
+// starting right after the version preamble, and truncates the file to the
+// end of the last record that decoded cleanly and passed its CRC check.
+//
+// This repairs the common crash scenario where a process dies mid-write and
+// leaves a short or corrupt record at the end of the file: without recovery,
+// NewDiskStore's KeyDir rebuild would have no way to tell a torn write from a
+// genuinely corrupt datafile. truncatedBytes reports how many trailing bytes
+// were discarded, which is 0 for a file that was already well-formed.
+func RecoverFile(path string) (truncatedBytes int64, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := fi.Size()
+
+	if size < preambleSize {
+		return 0, fmt.Errorf("recover %s: file is smaller than the version preamble", path)
+	}
+
+	version := make([]byte, preambleSize)
+	if _, err := f.ReadAt(version, 0); err != nil {
+		return 0, fmt.Errorf("recover %s: reading version: %w", path, err)
+	}
+	if version[0] != fileFormatVersion {
+		return 0, fmt.Errorf("recover %s: unsupported datafile version %d, expected %d", path, version[0], fileFormatVersion)
+	}
+
+	pos := int64(preambleSize)
+	for {
+		headerBuf := make([]byte, headerSize)
+		if _, err := f.ReadAt(headerBuf, pos); err != nil {
+			// A short read means a torn header; stop here.
+			break
+		}
+
+		h, err := headerFromBytes(headerBuf)
+		if err != nil {
+			break
+		}
+
+		recordSize := int64(h.KeyLen())
+		payload := make([]byte, recordSize-headerSize)
+		if _, err := f.ReadAt(payload, pos+headerSize); err != nil {
+			// A short read means a torn record; stop here.
+			break
+		}
+
+		if recordChecksum(h, payload) != h.crc {
+			// A CRC mismatch means this record, and everything after it,
+			// can no longer be trusted.
+			break
+		}
+
+		pos += recordSize
+	}
+
+	if pos == size {
+		return 0, nil
+	}
+
+	if err := f.Truncate(pos); err != nil {
+		return 0, fmt.Errorf("recover %s: truncating to offset %d: %w", path, pos, err)
+	}
+
+	return size - pos, nil
+}
@@ -0,0 +1,86 @@
+package caskdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestDataFile creates a datafile at path containing the version
+// preamble followed by the records produced by encode.
+func writeTestDataFile(t *testing.T, path string, records ...[]byte) {
+	t.Helper()
+
+	var buf []byte
+	buf = append(buf, fileFormatVersion)
+	for _, r := range records {
+		buf = append(buf, r...)
+	}
+	if err := os.WriteFile(path, buf, 0644); err != nil {
+		t.Fatalf("writing test datafile: %v", err)
+	}
+}
+
+func TestRecoverFileNoCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "000000000.data")
+	_, rec1 := encodeKV(1, "hamlet", "shakespeare")
+	_, rec2 := encodeKV(2, "anna karenina", "tolstoy")
+	writeTestDataFile(t, path, rec1, rec2)
+
+	truncated, err := RecoverFile(path)
+	if err != nil {
+		t.Fatalf("RecoverFile: %v", err)
+	}
+	if truncated != 0 {
+		t.Fatalf("truncated = %d, want 0 for a well-formed file", truncated)
+	}
+}
+
+func TestRecoverFileTruncatesTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "000000000.data")
+	_, rec1 := encodeKV(1, "hamlet", "shakespeare")
+	_, rec2 := encodeKV(2, "anna karenina", "tolstoy")
+	writeTestDataFile(t, path, rec1, rec2)
+
+	// Simulate a crash mid-write: chop off the last few bytes of rec2.
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, fi.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	truncated, err := RecoverFile(path)
+	if err != nil {
+		t.Fatalf("RecoverFile: %v", err)
+	}
+	wantTruncated := int64(len(rec2)) - 3
+	if truncated != wantTruncated {
+		t.Errorf("truncated %d bytes, want %d", truncated, wantTruncated)
+	}
+
+	fi, err = os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(1+len(rec1)) {
+		t.Errorf("recovered file is %d bytes, want %d (preamble + first record)", fi.Size(), 1+len(rec1))
+	}
+}
+
+func TestRecoverFileTruncatesCorruptCRC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "000000000.data")
+	_, rec1 := encodeKV(1, "hamlet", "shakespeare")
+	_, rec2 := encodeKV(2, "anna karenina", "tolstoy")
+	rec2[len(rec2)-1] ^= 0xFF // flip a byte inside the value, after the crc was computed
+	writeTestDataFile(t, path, rec1, rec2)
+
+	truncated, err := RecoverFile(path)
+	if err != nil {
+		t.Fatalf("RecoverFile: %v", err)
+	}
+	if truncated != int64(len(rec2)) {
+		t.Errorf("truncated %d bytes, want %d (the whole corrupt record)", truncated, len(rec2))
+	}
+}
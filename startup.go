@@ -0,0 +1,183 @@
+package caskdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// rebuildKeyDir populates d.index from the datafiles already opened in
+// d.active and d.immutable. Files are scanned in ascending id order, which
+// is also chronological order (a datafile produced by Merge keeps the
+// original write timestamps of the records it copies, but is only ever
+// assigned an id higher than the immutable files it replaces), so later
+// scans simply overwrite earlier ones without needing to compare
+// timestamps across files.
+//
+// Immutable datafiles that have a companion hint file use it instead of
+// scanning the full datafile, keeping startup time proportional to the
+// number of live keys rather than the total bytes ever written.
+func (d *DiskStore) rebuildKeyDir(loadTimeout time.Duration, progress func(int, int)) error {
+	var deadline time.Time
+	if loadTimeout > 0 {
+		deadline = time.Now().Add(loadTimeout)
+	}
+	now := uint32(time.Now().Unix())
+
+	ids := make([]uint32, 0, len(d.immutable)+1)
+	for id := range d.immutable {
+		ids = append(ids, id)
+	}
+	if d.active != nil {
+		ids = append(ids, d.active.id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for i, id := range ids {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return fmt.Errorf("rebuilding KeyDir: exceeded LoadTimeout of %s", loadTimeout)
+		}
+
+		if d.active == nil || id != d.active.id {
+			used, err := d.loadFromHintFile(id, now)
+			if err != nil {
+				return err
+			}
+			if used {
+				if progress != nil {
+					progress(i+1, len(ids))
+				}
+				continue
+			}
+		}
+
+		df, err := d.fileForID(id)
+		if err != nil {
+			return err
+		}
+		d.loadFromDataFile(df, now)
+
+		if progress != nil {
+			progress(i+1, len(ids))
+		}
+	}
+
+	return nil
+}
+
+// loadFromDataFile scans df sequentially from the end of the version
+// preamble, decoding just enough of each record (header + key) to update
+// d.index. It stops, without returning an error, as soon as it hits a
+// header or record that doesn't fully fit before the end of the file: that
+// is exactly what a datafile with a torn tail from a crashed write looks
+// like, and RecoverFile is the tool for actually repairing it.
+//
+// A record whose expiry has already passed as of now is treated the same
+// as a tombstone: it must not resurrect a key that the background sweeper
+// or Merge had already forgotten before the restart.
+func (d *DiskStore) loadFromDataFile(df *dataFile, now uint32) {
+	pos := int64(preambleSize)
+	for pos < df.size {
+		headerBuf := make([]byte, headerSize)
+		if err := df.readAt(headerBuf, pos); err != nil {
+			return
+		}
+
+		h, err := headerFromBytes(headerBuf)
+		if err != nil {
+			return
+		}
+
+		recordSize := int64(h.KeyLen())
+		if pos+recordSize > df.size {
+			return
+		}
+
+		keyBuf := make([]byte, h.keySize)
+		if err := df.readAt(keyBuf, pos+int64(headerSize)); err != nil {
+			return
+		}
+
+		if h.recordType == recordTypeTombstone || (h.expiry != 0 && h.expiry <= now) {
+			d.index.Delete(keyBuf)
+		} else {
+			d.index.Put(keyBuf, keyEntry{
+				fileId:    df.id,
+				valuePos:  pos,
+				valueSize: uint(recordSize),
+				timestamp: h.timestamp,
+				expiry:    h.expiry,
+			})
+		}
+
+		pos += recordSize
+	}
+}
+
+// loadFromHintFile populates d.index from the hint file for datafile id,
+// if one exists, skipping any entry whose expiry has already passed as of
+// now. It reports whether a hint file was found and used.
+func (d *DiskStore) loadFromHintFile(id uint32, now uint32) (bool, error) {
+	path := hintFilePath(d.dir, id)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	size := fi.Size()
+
+	version := make([]byte, preambleSize)
+	if _, err := f.ReadAt(version, 0); err != nil {
+		return false, fmt.Errorf("reading hint file %s: %w", path, err)
+	}
+	if version[0] != fileFormatVersion {
+		return false, fmt.Errorf("hint file %s: unsupported version %d, expected %d", path, version[0], fileFormatVersion)
+	}
+
+	pos := int64(preambleSize)
+	for pos+hintHeaderSize <= size {
+		hdr := make([]byte, hintHeaderSize)
+		if _, err := f.ReadAt(hdr, pos); err != nil {
+			return false, fmt.Errorf("reading hint file %s at offset %d: %w", path, pos, err)
+		}
+
+		timestamp := binary.LittleEndian.Uint32(hdr[0:])
+		keySize := binary.LittleEndian.Uint32(hdr[4:])
+		valueSize := binary.LittleEndian.Uint32(hdr[8:])
+		valuePos := int64(binary.LittleEndian.Uint64(hdr[12:]))
+		expiry := binary.LittleEndian.Uint32(hdr[20:])
+
+		if pos+hintHeaderSize+int64(keySize) > size {
+			return false, fmt.Errorf("hint file %s: truncated entry at offset %d", path, pos)
+		}
+
+		keyBuf := make([]byte, keySize)
+		if _, err := f.ReadAt(keyBuf, pos+hintHeaderSize); err != nil {
+			return false, fmt.Errorf("reading hint file %s at offset %d: %w", path, pos+hintHeaderSize, err)
+		}
+
+		if expiry == 0 || expiry > now {
+			d.index.Put(keyBuf, keyEntry{
+				fileId:    id,
+				valuePos:  valuePos,
+				valueSize: uint(valueSize),
+				timestamp: timestamp,
+				expiry:    expiry,
+			})
+		}
+
+		pos += hintHeaderSize + int64(keySize)
+	}
+
+	return true, nil
+}
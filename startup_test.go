@@ -0,0 +1,249 @@
+package caskdb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestRebuildFromDataFileScanMatchesLiveStore checks that reopening a store
+// (with no hint files present, since Merge was never run) reconstructs the
+// exact same key/value pairs a live store has, including overwrites and
+// deletes.
+func TestRebuildFromDataFileScanMatchesLiveStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir, nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+
+	if err := store.Set("hamlet", "shakespeare-draft"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("hamlet", "shakespeare"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("anna karenina", "tolstoy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("to be deleted", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("to be deleted"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := NewDiskStore(dir, nil)
+	if err != nil {
+		t.Fatalf("reopening NewDiskStore: %v", err)
+	}
+	defer reopened.Close()
+
+	if val, err := reopened.Get("hamlet"); err != nil || val != "shakespeare" {
+		t.Errorf("Get(hamlet) = (%q, %v), want (\"shakespeare\", nil)", val, err)
+	}
+	if val, err := reopened.Get("anna karenina"); err != nil || val != "tolstoy" {
+		t.Errorf("Get(anna karenina) = (%q, %v), want (\"tolstoy\", nil)", val, err)
+	}
+	if reopened.Has("to be deleted") {
+		t.Error("Has(to be deleted) = true after rebuild, want false (it was deleted before restart)")
+	}
+	if reopened.Len() != 2 {
+		t.Errorf("Len() after rebuild = %d, want 2", reopened.Len())
+	}
+}
+
+// TestRebuildFromHintFileMatchesDataFileScan checks that after a Merge
+// produces hint files, rebuilding the KeyDir from those hint files sees the
+// exact same entries that scanning the merged datafiles directly would.
+func TestRebuildFromHintFileMatchesDataFileScan(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir, &Options{MaxFileSize: 256})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+
+	want := map[string]string{}
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		val := fmt.Sprintf("value-%d", i)
+		if err := store.Set(key, val); err != nil {
+			t.Fatal(err)
+		}
+		want[key] = val
+	}
+
+	if err := store.Merge(); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	// Every immutable datafile should now have a companion hint file.
+	for id := range store.immutable {
+		if !isFileExists(hintFilePath(dir, id)) {
+			t.Errorf("datafile %d has no hint file after Merge", id)
+		}
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := NewDiskStore(dir, &Options{MaxFileSize: 256})
+	if err != nil {
+		t.Fatalf("reopening NewDiskStore: %v", err)
+	}
+	defer reopened.Close()
+
+	if reopened.Len() != len(want) {
+		t.Fatalf("Len() after hint-file rebuild = %d, want %d", reopened.Len(), len(want))
+	}
+	for key, val := range want {
+		got, err := reopened.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		if got != val {
+			t.Errorf("Get(%q) = %q, want %q", key, got, val)
+		}
+	}
+}
+
+// TestRebuildStopsAtTornTail checks that a torn final record (as left by a
+// crash mid-write) is silently ignored by the KeyDir rebuild rather than
+// causing NewDiskStore to fail, leaving every earlier record intact.
+func TestRebuildStopsAtTornTail(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir, nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	if err := store.Set("hamlet", "shakespeare"); err != nil {
+		t.Fatal(err)
+	}
+	activeID := store.active.id
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	path := dataFilePath(dir, activeID)
+	if _, err := RecoverFile(path); err != nil {
+		t.Fatal(err)
+	}
+	// Append a torn record after the last valid one.
+	f, err := openDataFile(dir, activeID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, torn := encodeKV(1, "torn-key", "torn-value")
+	if _, err := f.append(torn[:len(torn)-5]); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewDiskStore(dir, nil)
+	if err != nil {
+		t.Fatalf("reopening a datafile with a torn tail should not fail NewDiskStore: %v", err)
+	}
+	defer reopened.Close()
+
+	if val, err := reopened.Get("hamlet"); err != nil || val != "shakespeare" {
+		t.Errorf("Get(hamlet) = (%q, %v), want (\"shakespeare\", nil)", val, err)
+	}
+	if reopened.Has("torn-key") {
+		t.Error("Has(torn-key) = true, want false: the torn record must not be visible")
+	}
+}
+
+// makeMultiFileStore creates a store with several datafiles on disk (by
+// writing enough records to force rotation under a tiny MaxFileSize) and
+// closes it, ready to be reopened by the test.
+func makeMultiFileStore(t *testing.T, dir string) int {
+	t.Helper()
+
+	store, err := NewDiskStore(dir, &Options{MaxFileSize: 64})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := store.Set(fmt.Sprintf("key-%d", i), "some reasonably long value"); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	ids, err := listDataFileIDs(dir)
+	if err != nil {
+		t.Fatalf("listDataFileIDs: %v", err)
+	}
+	if len(ids) < 2 {
+		t.Fatalf("test setup produced only %d datafile(s), want at least 2", len(ids))
+	}
+	return len(ids)
+}
+
+// TestLoadTimeoutFailsRebuild checks that an already-elapsed LoadTimeout
+// surfaces as an error from NewDiskStore instead of being ignored, on a
+// rebuild that spans multiple datafiles.
+func TestLoadTimeoutFailsRebuild(t *testing.T) {
+	dir := t.TempDir()
+	makeMultiFileStore(t, dir)
+
+	if _, err := NewDiskStore(dir, &Options{MaxFileSize: 64, LoadTimeout: time.Nanosecond}); err == nil {
+		t.Fatal("NewDiskStore with an already-elapsed LoadTimeout did not return an error")
+	}
+}
+
+// TestLoadTimeoutZeroMeansNoTimeout checks that the documented "zero means
+// no timeout" behavior actually holds, so LoadTimeoutFailsRebuild is
+// exercising LoadTimeout and not some unrelated failure.
+func TestLoadTimeoutZeroMeansNoTimeout(t *testing.T) {
+	dir := t.TempDir()
+	makeMultiFileStore(t, dir)
+
+	store, err := NewDiskStore(dir, &Options{MaxFileSize: 64})
+	if err != nil {
+		t.Fatalf("NewDiskStore with LoadTimeout unset: %v", err)
+	}
+	defer store.Close()
+}
+
+// TestLoadProgressReportsEveryFile checks that LoadProgress is called once
+// per datafile scanned, with a strictly increasing filesScanned count and a
+// totalFiles that matches how many datafiles were actually on disk.
+func TestLoadProgressReportsEveryFile(t *testing.T) {
+	dir := t.TempDir()
+	wantFiles := makeMultiFileStore(t, dir)
+
+	var calls [][2]int
+	store, err := NewDiskStore(dir, &Options{
+		MaxFileSize: 64,
+		LoadProgress: func(filesScanned, totalFiles int) {
+			calls = append(calls, [2]int{filesScanned, totalFiles})
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	if len(calls) != wantFiles {
+		t.Fatalf("LoadProgress was called %d times, want once per datafile (%d)", len(calls), wantFiles)
+	}
+	for i, c := range calls {
+		filesScanned, totalFiles := c[0], c[1]
+		if totalFiles != wantFiles {
+			t.Errorf("call %d: totalFiles = %d, want %d", i, totalFiles, wantFiles)
+		}
+		if filesScanned != i+1 {
+			t.Errorf("call %d: filesScanned = %d, want %d", i, filesScanned, i+1)
+		}
+	}
+}
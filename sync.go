@@ -0,0 +1,80 @@
+package caskdb
+
+import "time"
+
+// syncMode identifies which fsync strategy a SyncPolicy uses.
+type syncMode int
+
+const (
+	syncNone syncMode = iota
+	syncAlways
+	syncInterval
+)
+
+// SyncPolicy controls when a DiskStore fsyncs its active datafile. The zero
+// value is SyncNone. Construct one with SyncNone, SyncAlways or
+// SyncInterval and assign it to Options.Sync.
+type SyncPolicy struct {
+	mode     syncMode
+	interval time.Duration
+}
+
+// SyncNone never fsyncs the active datafile on its own, leaving it to the OS
+// to flush dirty pages in its own time. This is the fastest policy, but a
+// crash (as opposed to just the process exiting) can lose writes that were
+// acknowledged but never reached disk. A datafile is still fsynced once,
+// regardless of policy, when it is sealed; see DiskStore.rotate.
+func SyncNone() SyncPolicy {
+	return SyncPolicy{mode: syncNone}
+}
+
+// SyncAlways fsyncs the active datafile after every Set, Delete and
+// Batch.Commit, so every call that returns a nil error is durable. This is
+// the safest policy, at the cost of one fsync per write.
+func SyncAlways() SyncPolicy {
+	return SyncPolicy{mode: syncAlways}
+}
+
+// SyncInterval fsyncs the active datafile from a background goroutine
+// every d, bounding how much data a crash can lose without paying for an
+// fsync on every write. It has no effect on datafiles that stop being
+// active (they are fsynced once, when they are sealed).
+func SyncInterval(d time.Duration) SyncPolicy {
+	return SyncPolicy{mode: syncInterval, interval: d}
+}
+
+// Sync flushes the active datafile to stable storage.
+func (d *DiskStore) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.active.sync()
+}
+
+// syncLocked fsyncs the active datafile if policy is SyncAlways. Callers
+// must already hold d.mu for writing.
+func (d *DiskStore) syncLocked() error {
+	if d.syncPolicy.mode != syncAlways {
+		return nil
+	}
+	return d.active.sync()
+}
+
+// runSyncLoop fsyncs the active datafile every d until stop is closed, then
+// signals done and returns. It is started by NewDiskStore when
+// Options.Sync is a SyncInterval policy.
+func (d *DiskStore) runSyncLoop(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			d.Sync()
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package caskdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSyncPolicyDefaultsToSyncNone(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	if store.syncPolicy.mode != syncNone {
+		t.Fatalf("default SyncPolicy mode = %v, want syncNone", store.syncPolicy.mode)
+	}
+	if store.syncStop != nil {
+		t.Fatal("SyncNone should not start a background sync loop")
+	}
+}
+
+func TestSyncAlwaysFsyncsOnEveryWrite(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), &Options{MaxFileSize: 4096, Sync: SyncAlways()})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.Set("hamlet", "shakespeare"); err != nil {
+		t.Fatalf("Set under SyncAlways: %v", err)
+	}
+	if store.active.syncCount != 1 {
+		t.Fatalf("active.syncCount after one Set under SyncAlways = %d, want 1", store.active.syncCount)
+	}
+	if err := store.Delete("hamlet"); err != nil {
+		t.Fatalf("Delete under SyncAlways: %v", err)
+	}
+	if store.active.syncCount != 2 {
+		t.Fatalf("active.syncCount after Set+Delete under SyncAlways = %d, want 2", store.active.syncCount)
+	}
+}
+
+// TestRotateFsyncsSealedDataFileButNotTheNewOne checks that rotate flushes
+// the outgoing datafile's dirty pages before sealing it, regardless of
+// SyncPolicy, while the freshly created active datafile — which has nothing
+// to flush yet — is left alone.
+func TestRotateFsyncsSealedDataFileButNotTheNewOne(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), &Options{MaxFileSize: 32, Sync: SyncNone()})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.Set("hamlet", "shakespeare"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	sealedID := store.active.id
+
+	// This Set overflows MaxFileSize, forcing a rotation.
+	if err := store.Set("anna karenina", "tolstoy"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	sealed, ok := store.immutable[sealedID]
+	if !ok {
+		t.Fatalf("datafile %d was not sealed into immutable", sealedID)
+	}
+	if sealed.syncCount == 0 {
+		t.Error("sealed datafile has syncCount 0, want at least 1: rotate must fsync it before sealing")
+	}
+	if store.active.syncCount != 0 {
+		t.Errorf("new active datafile has syncCount %d, want 0: it has nothing to flush yet", store.active.syncCount)
+	}
+}
+
+func TestSyncIntervalStartsAndStopsBackgroundLoop(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), &Options{MaxFileSize: 4096, Sync: SyncInterval(5 * time.Millisecond)})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+
+	if store.syncStop == nil {
+		t.Fatal("SyncInterval should start a background sync loop")
+	}
+
+	if err := store.Set("hamlet", "shakespeare"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	// Give the background loop a couple of ticks to run; it should not
+	// panic or deadlock against concurrent Set/Get.
+	time.Sleep(20 * time.Millisecond)
+	if _, err := store.Get("hamlet"); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestExplicitSync(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.Set("hamlet", "shakespeare"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := store.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+}
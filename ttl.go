@@ -0,0 +1,107 @@
+package caskdb
+
+import (
+	"fmt"
+	"time"
+)
+
+// isExpired reports whether entry's TTL has passed as of now.
+func isExpired(entry keyEntry, now uint32) bool {
+	return entry.expiry != 0 && entry.expiry <= now
+}
+
+// setWithExpiry is the shared implementation behind Set, SetWithTTL and
+// SetWithExpiry: it only differs in what expiry (a unix timestamp in
+// seconds, or 0 for never) it stores alongside the record.
+func (d *DiskStore) setWithExpiry(key string, value string, expiry uint32) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	timestamp := uint32(time.Now().Unix())
+	dataLen, data := encodeKVWithExpiry(timestamp, key, value, expiry)
+
+	pos, fileID, err := d.appendRecord(data)
+	if err != nil {
+		return fmt.Errorf("writing key %q: %w", key, err)
+	}
+	if err := d.syncLocked(); err != nil {
+		return fmt.Errorf("writing key %q: %w", key, err)
+	}
+
+	d.index.Put([]byte(key), keyEntry{
+		fileId:    fileID,
+		timestamp: timestamp,
+		valueSize: uint(dataLen),
+		valuePos:  pos,
+		expiry:    expiry,
+	})
+	return nil
+}
+
+// SetWithTTL stores value under key, like Set, but the record expires and
+// is treated as deleted once ttl has elapsed. The expiry is stored in whole
+// unix seconds, truncating the fraction, so the key can be treated as
+// deleted up to a second before ttl has fully elapsed.
+func (d *DiskStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	return d.setWithExpiry(key, value, uint32(time.Now().Add(ttl).Unix()))
+}
+
+// SetWithExpiry stores value under key, like Set, but the record expires
+// and is treated as deleted once at, truncated to a whole unix second, has
+// passed. The zero time.Time is
+// treated as "never expires", the same as Set, rather than as a timestamp
+// in the distant past.
+func (d *DiskStore) SetWithExpiry(key string, value string, at time.Time) error {
+	if at.IsZero() {
+		return d.setWithExpiry(key, value, 0)
+	}
+	return d.setWithExpiry(key, value, uint32(at.Unix()))
+}
+
+// startExpirySweep launches the background eviction goroutine if
+// Options.ExpirySweepInterval was positive. It is a no-op otherwise.
+func (d *DiskStore) startExpirySweep(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	d.expiryStop = make(chan struct{})
+	d.expiryDone = make(chan struct{})
+	go d.runExpirySweep(interval, d.expiryStop, d.expiryDone)
+}
+
+// runExpirySweep drops every expired key from the KeyDir every interval,
+// until stop is closed. It does not touch the datafiles directly; Merge is
+// what actually reclaims the disk space an expired key occupied.
+func (d *DiskStore) runExpirySweep(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			d.sweepExpired()
+		}
+	}
+}
+
+// sweepExpired drops every expired key from the KeyDir.
+func (d *DiskStore) sweepExpired() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := uint32(time.Now().Unix())
+	var expired []string
+	d.index.Scan(nil, func(key []byte, entry keyEntry) bool {
+		if isExpired(entry, now) {
+			expired = append(expired, string(key))
+		}
+		return true
+	})
+	for _, key := range expired {
+		d.index.Delete([]byte(key))
+	}
+}
@@ -0,0 +1,156 @@
+package caskdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetWithTTLExpires(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	// expiry is stored as unix seconds, so the TTL must span a full second
+	// boundary for the before/after assertions below to be meaningful.
+	if err := store.SetWithTTL("hamlet", "shakespeare", 1100*time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL: %v", err)
+	}
+	if val, err := store.Get("hamlet"); err != nil || val != "shakespeare" {
+		t.Fatalf("Get before TTL elapses = (%q, %v), want (\"shakespeare\", nil)", val, err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	if val, err := store.Get("hamlet"); err != nil || val != "" {
+		t.Fatalf("Get after TTL elapses = (%q, %v), want (\"\", nil)", val, err)
+	}
+	if store.Has("hamlet") {
+		t.Fatal("Has after TTL elapses = true, want false")
+	}
+}
+
+func TestSetWithExpiryZeroTimeNeverExpires(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SetWithExpiry("hamlet", "shakespeare", time.Time{}); err != nil {
+		t.Fatalf("SetWithExpiry: %v", err)
+	}
+	if val, err := store.Get("hamlet"); err != nil || val != "shakespeare" {
+		t.Fatalf("Get(hamlet) = (%q, %v), want (\"shakespeare\", nil)", val, err)
+	}
+}
+
+func TestSetWithExpiryInThePast(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SetWithExpiry("hamlet", "shakespeare", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("SetWithExpiry: %v", err)
+	}
+	if val, err := store.Get("hamlet"); err != nil || val != "" {
+		t.Fatalf("Get(hamlet) with a past expiry = (%q, %v), want (\"\", nil)", val, err)
+	}
+}
+
+// TestLenIncludesUnsweptExpiredKeys documents that Len counts expired keys
+// until the background sweeper or Merge drops them from the KeyDir; a Get
+// does not.
+func TestLenIncludesUnsweptExpiredKeys(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SetWithTTL("hamlet", "shakespeare", 1100*time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL: %v", err)
+	}
+	time.Sleep(2 * time.Second)
+
+	if store.Len() != 1 {
+		t.Fatalf("Len() before anything sweeps the expired key = %d, want 1", store.Len())
+	}
+
+	// A Get for the expired key does not itself drop it from the KeyDir.
+	store.Get("hamlet")
+	if store.Len() != 1 {
+		t.Fatalf("Len() after Get of an expired key = %d, want 1 (Get does not evict)", store.Len())
+	}
+}
+
+func TestBackgroundExpirySweepDropsExpiredKeys(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), &Options{MaxFileSize: 4096, ExpirySweepInterval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	// expiry is stored as unix seconds, so the TTL must span a full second
+	// boundary for the key to actually be treated as expired.
+	if err := store.SetWithTTL("hamlet", "shakespeare", 1100*time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL: %v", err)
+	}
+	if err := store.Set("permanent", "value"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for store.Len() != 1 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if store.Len() != 1 {
+		t.Fatalf("Len() after the background sweeper had time to run = %d, want 1 (only \"permanent\" left)", store.Len())
+	}
+	if store.Has("hamlet") {
+		t.Fatal("Has(hamlet) = true after the background sweeper ran, want false")
+	}
+	if !store.Has("permanent") {
+		t.Fatal("Has(permanent) = false, want true: only the expired key should have been swept")
+	}
+}
+
+func TestMergeDropsExpiredKeys(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), &Options{MaxFileSize: 4096})
+	if err != nil {
+		t.Fatalf("NewDiskStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SetWithTTL("hamlet", "shakespeare", 1100*time.Millisecond); err != nil {
+		t.Fatalf("SetWithTTL: %v", err)
+	}
+	if err := store.Set("permanent", "value"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	// Force the records into an immutable datafile so Merge has something
+	// to compact.
+	store.mu.Lock()
+	err = store.rotate()
+	store.mu.Unlock()
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	if err := store.Merge(); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	if store.Has("hamlet") {
+		t.Fatal("Has(hamlet) = true after Merge, want false: Merge should drop expired keys")
+	}
+	if !store.Has("permanent") {
+		t.Fatal("Has(permanent) = false after Merge, want true")
+	}
+}